@@ -19,26 +19,45 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	ec22 "github.com/aws/aws-sdk-go/service/ec2"
-	"github.com/aws/karpenter/pkg/cloudprovider/aws"
+	karpenteraws "github.com/aws/karpenter/pkg/cloudprovider/aws"
 	"go/format"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime"
 	"runtime/pprof"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
+var (
+	regionsFlag = flag.String("regions", "us-east-1", `comma-separated list of regions to generate pricing for, or "all" to enumerate every commercial region`)
+	workers     = flag.Int("workers", 8, "maximum number of regions to fetch pricing for concurrently")
+	sourceFlag  = flag.String("source", "live", `where to read on-demand pricing from: "live" (default, uses the AWS Pricing API), "file:<path>" to read an AWS Price List Bulk JSON file (<path> may contain a "%s" for the region), or "bulk-url[:<url>]" to fetch the bulk JSON over HTTP`)
+)
+
+// regionResult holds the outcome of fetching pricing for a single region.
+type regionResult struct {
+	region   string
+	provider *karpenteraws.PricingProvider
+}
+
 func main() {
 	flag.Parse()
 	if flag.NArg() != 1 {
-		log.Printf("Usage: %s pkg/cloudprovider/aws/zz_generated.pricing.go", os.Args[0])
+		log.Printf("Usage: %s pkg/cloudprovider/aws", os.Args[0])
 		os.Exit(1)
 	}
+	outDir := flag.Arg(0)
+	if *workers < 1 {
+		log.Fatalf("-workers must be >= 1, got %d", *workers)
+	}
 
 	f, err := os.Create("pricing.heapprofile")
 	if err != nil {
@@ -46,47 +65,245 @@ func main() {
 	}
 	defer f.Close() // error handling omitted for example
 
-	const region = "us-east-1"
 	os.Setenv("AWS_SDK_LOAD_CONFIG", "true")
-	os.Setenv("AWS_REGION", region)
 	ctx := context.Background()
 	sess := session.Must(session.NewSession())
-	ec2 := ec22.New(sess)
+
+	regions := resolveRegions(sess, *regionsFlag)
+	sort.Strings(regions)
+	log.Printf("generating pricing for regions: %s", strings.Join(regions, ", "))
+
+	newSource := sourceFactory(*sourceFlag, sess)
+	results := fetchRegions(ctx, sess, newSource, regions, *workers)
+
+	aggregate := &bytes.Buffer{}
+	fmt.Fprintln(aggregate, "//go:build !ignore_autogenerated")
+	fmt.Fprintln(aggregate, "package aws")
+	fmt.Fprintf(aggregate, "// generated at %s across %d regions\n\n\n", time.Now().UTC().Format(time.RFC3339), len(results))
+	fmt.Fprintln(aggregate, "var initialOnDemandPrices = map[string]map[string]float64{")
+	for _, result := range results {
+		fmt.Fprintf(aggregate, "\"%s\": %s,\n", result.region, onDemandVarName(result.region))
+	}
+	fmt.Fprintln(aggregate, "}")
+	fmt.Fprintln(aggregate)
+	fmt.Fprintln(aggregate, "var initialSpotPrices = map[string]map[string]map[string]float64{")
+	for _, result := range results {
+		fmt.Fprintf(aggregate, "\"%s\": %s,\n", result.region, spotVarName(result.region))
+	}
+	fmt.Fprintln(aggregate, "}")
+	fmt.Fprintln(aggregate)
+	fmt.Fprintln(aggregate, "var initialEBSPrices = map[string]map[string]float64{")
+	for _, result := range results {
+		fmt.Fprintf(aggregate, "\"%s\": %s,\n", result.region, ebsVarName(result.region))
+	}
+	fmt.Fprintln(aggregate, "}")
+	fmt.Fprintln(aggregate)
+	fmt.Fprintln(aggregate, "var initialEBSIOPSPrices = map[string]map[string]float64{")
+	for _, result := range results {
+		fmt.Fprintf(aggregate, "\"%s\": %s,\n", result.region, ebsIOPSVarName(result.region))
+	}
+	fmt.Fprintln(aggregate, "}")
+	fmt.Fprintln(aggregate)
+	fmt.Fprintln(aggregate, "var initialEBSThroughputPrices = map[string]map[string]float64{")
+	for _, result := range results {
+		fmt.Fprintf(aggregate, "\"%s\": %s,\n", result.region, ebsThroughputVarName(result.region))
+	}
+	fmt.Fprintln(aggregate, "}")
+	writeFormatted(filepath.Join(outDir, "zz_generated.pricing.go"), aggregate)
+
+	for _, result := range results {
+		writeRegionFile(outDir, result)
+	}
+
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		log.Fatal("could not write memory profile: ", err)
+	}
+}
+
+// resolveRegions turns the -regions flag into a concrete list of region
+// names, enumerating via EC2 DescribeRegions when the flag is "all".
+// AllRegions is set to true so the enumeration covers every commercial
+// region regardless of whether the generating account has opted into it,
+// since the whole point of "all" is offline fallback pricing that doesn't
+// depend on which account built it.
+func resolveRegions(sess *session.Session, regionsFlag string) []string {
+	if regionsFlag != "all" {
+		return strings.Split(regionsFlag, ",")
+	}
+	ec2Client := ec22.New(sess, aws.NewConfig().WithRegion("us-east-1"))
+	out, err := ec2Client.DescribeRegions(&ec22.DescribeRegionsInput{AllRegions: aws.Bool(true)})
+	if err != nil {
+		log.Fatalf("enumerating regions, %s", err)
+	}
+	var regions []string
+	for _, region := range out.Regions {
+		regions = append(regions, *region.RegionName)
+	}
+	return regions
+}
+
+// sourceFactory parses the -source flag into a function that builds a
+// karpenteraws.PricingSource for a given region. "live" uses the AWS session
+// passed to the generator; "file" and "bulk-url" do not need one.
+func sourceFactory(sourceFlag string, sess *session.Session) func(region string) karpenteraws.PricingSource {
+	switch {
+	case sourceFlag == "live":
+		return func(region string) karpenteraws.PricingSource {
+			return karpenteraws.NewLivePricingSource(karpenteraws.NewPricingAPI(sess, region))
+		}
+	case strings.HasPrefix(sourceFlag, "file:"):
+		path := strings.TrimPrefix(sourceFlag, "file:")
+		return func(region string) karpenteraws.PricingSource {
+			return karpenteraws.NewFilePricingSource(path)
+		}
+	case sourceFlag == "bulk-url" || strings.HasPrefix(sourceFlag, "bulk-url:"):
+		url := strings.TrimPrefix(strings.TrimPrefix(sourceFlag, "bulk-url"), ":")
+		return func(region string) karpenteraws.PricingSource {
+			return karpenteraws.NewBulkURLPricingSource(url)
+		}
+	default:
+		log.Fatalf("unrecognized -source %q", sourceFlag)
+		return nil
+	}
+}
+
+// fetchRegions fetches on-demand, spot, and EBS pricing for each region concurrently,
+// bounded by workers, sharing the single AWS session passed in.
+func fetchRegions(ctx context.Context, sess *session.Session, newSource func(region string) karpenteraws.PricingSource, regions []string, workers int) []regionResult {
+	regionCh := make(chan string)
+	resultCh := make(chan regionResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for region := range regionCh {
+				resultCh <- regionResult{region: region, provider: fetchRegion(ctx, sess, newSource(region), region)}
+			}
+		}()
+	}
+	go func() {
+		for _, region := range regions {
+			regionCh <- region
+		}
+		close(regionCh)
+	}()
+	go func() {
+		wg.Wait()
+		close(resultCh)
+	}()
+
+	results := make([]regionResult, 0, len(regions))
+	for result := range resultCh {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].region < results[j].region })
+	return results
+}
+
+// fetchRegion blocks until the on-demand, spot, and EBS pricing caches for
+// region have each completed at least one refresh.
+func fetchRegion(ctx context.Context, sess *session.Session, source karpenteraws.PricingSource, region string) *karpenteraws.PricingProvider {
+	ec2Client := ec22.New(sess, aws.NewConfig().WithRegion(region))
 	updateStarted := time.Now()
-	pricingProvider := aws.NewPricingProvider(ctx, aws.NewPricingAPI(sess, region), ec2, region, false, make(chan struct{}))
+	pricingProvider := karpenteraws.NewPricingProvider(ctx, source, ec2Client, region, false, 0, make(chan struct{}))
 
 	for {
-		if pricingProvider.OnDemandLastUpdated().After(updateStarted) && pricingProvider.SpotLastUpdated().After(updateStarted) {
+		if pricingProvider.OnDemandLastUpdated().After(updateStarted) &&
+			pricingProvider.SpotLastUpdated().After(updateStarted) &&
+			pricingProvider.EBSLastUpdated().After(updateStarted) {
 			break
 		}
-		log.Println("waiting on pricing update...")
+		log.Printf("waiting on pricing update for %s...", region)
 		time.Sleep(1 * time.Second)
 	}
+	return pricingProvider
+}
 
+// writeRegionFile emits zz_generated.pricing_<region>.go, containing the
+// region-scoped on-demand, spot, and EBS price maps for a single region.
+func writeRegionFile(outDir string, result regionResult) {
 	src := &bytes.Buffer{}
 	fmt.Fprintln(src, "//go:build !ignore_autogenerated")
 	fmt.Fprintln(src, "package aws")
 	fmt.Fprintln(src, `import "time"`)
-	now := time.Now().UTC().Format(time.RFC3339)
-	fmt.Fprintf(src, "// generated at %s for %s\n\n\n", now, region)
-	fmt.Fprintf(src, "var initialPriceUpdate, _ = time.Parse(time.RFC3339, \"%s\")\n", now)
+	onDemandGeneratedAt := result.provider.OnDemandLastUpdated().UTC().Format(time.RFC3339)
+	spotGeneratedAt := result.provider.SpotLastUpdated().UTC().Format(time.RFC3339)
+	ebsGeneratedAt := result.provider.EBSLastUpdated().UTC().Format(time.RFC3339)
+	fmt.Fprintf(src, "// on-demand pricing generated at %s for %s\n", onDemandGeneratedAt, result.region)
+	fmt.Fprintf(src, "// spot pricing generated at %s for %s\n", spotGeneratedAt, result.region)
+	fmt.Fprintf(src, "// EBS pricing generated at %s for %s\n\n\n", ebsGeneratedAt, result.region)
+	fmt.Fprintf(src, "var %s, _ = time.Parse(time.RFC3339, \"%s\")\n", priceUpdateVarName(result.region), onDemandGeneratedAt)
 
-	instanceTypes := pricingProvider.InstanceTypes()
+	instanceTypes := result.provider.InstanceTypes()
 	sort.Strings(instanceTypes)
 
-	writePricing(src, instanceTypes, "initialOnDemandPrices", pricingProvider.OnDemandPrice)
+	writePricing(src, instanceTypes, onDemandVarName(result.region), result.provider.OnDemandPrice)
+	writeSpotPricing(src, instanceTypes, spotVarName(result.region), result.provider)
 
-	formatted, err := format.Source(src.Bytes())
-	if err != nil {
-		log.Fatalf("formatting generated source, %s", err)
+	volumeTypes := result.provider.EBSVolumeTypes()
+	sort.Strings(volumeTypes)
+	writeEBSPricing(src, volumeTypes, ebsVarName(result.region), result.provider.EBSBasePrice)
+	writeEBSPricing(src, volumeTypes, ebsIOPSVarName(result.region), result.provider.EBSIOPSPrice)
+	writeEBSPricing(src, volumeTypes, ebsThroughputVarName(result.region), result.provider.EBSThroughputPrice)
+
+	writeFormatted(filepath.Join(outDir, fmt.Sprintf("zz_generated.pricing_%s.go", result.region)), src)
+}
+
+// onDemandVarName, spotVarName, ebsVarName, ebsIOPSVarName, and
+// ebsThroughputVarName produce the region-scoped variable names embedded in
+// each per-region generated file, e.g. "us-east-1" ->
+// "initialOnDemandPricesUsEast1".
+func onDemandVarName(region string) string {
+	return "initialOnDemandPrices" + regionIdentifier(region)
+}
+
+func spotVarName(region string) string {
+	return "initialSpotPrices" + regionIdentifier(region)
+}
+
+func ebsVarName(region string) string {
+	return "initialEBSPrices" + regionIdentifier(region)
+}
+
+func ebsIOPSVarName(region string) string {
+	return "initialEBSIOPSPrices" + regionIdentifier(region)
+}
+
+func ebsThroughputVarName(region string) string {
+	return "initialEBSThroughputPrices" + regionIdentifier(region)
+}
+
+// priceUpdateVarName is region-scoped like the price maps above: each
+// per-region file declares its own package-level var, so without a
+// region-scoped name every region's file after the first would redeclare the
+// same identifier and fail to compile.
+func priceUpdateVarName(region string) string {
+	return "initialPriceUpdate" + regionIdentifier(region)
+}
+
+// regionIdentifier converts a region name like "us-east-1" into the
+// PascalCase identifier segment "UsEast1".
+func regionIdentifier(region string) string {
+	segs := strings.Split(region, "-")
+	for i, seg := range segs {
+		if seg == "" {
+			continue
+		}
+		segs[i] = strings.ToUpper(seg[:1]) + seg[1:]
 	}
+	return strings.Join(segs, "")
+}
 
-	if err := ioutil.WriteFile(flag.Arg(0), formatted, 0644); err != nil {
-		log.Fatalf("writing output, %s", err)
+func writeFormatted(path string, src *bytes.Buffer) {
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		log.Fatalf("formatting generated source for %s, %s", path, err)
 	}
-	runtime.GC()
-	if err := pprof.WriteHeapProfile(f); err != nil {
-		log.Fatal("could not write memory profile: ", err)
+	if err := ioutil.WriteFile(path, formatted, 0644); err != nil {
+		log.Fatalf("writing output %s, %s", path, err)
 	}
 }
 
@@ -128,6 +345,63 @@ func writePricing(src *bytes.Buffer, instanceNames []string, varName string, get
 	fmt.Fprintln(src)
 }
 
+// writeSpotPricing emits a map[string]map[string]float64 keyed by
+// instanceType -> availabilityZone -> price, sorted by instance family and
+// then by zone so regenerating produces a stable, reviewable diff.
+func writeSpotPricing(src *bytes.Buffer, instanceNames []string, varName string, pricingProvider *karpenteraws.PricingProvider) {
+	fmt.Fprintf(src, "var %s = map[string]map[string]float64{\n", varName)
+	sort.Strings(instanceNames)
+	previousFamily := ""
+	for _, instanceName := range instanceNames {
+		zones := pricingProvider.SpotZones(instanceName)
+		if len(zones) == 0 {
+			continue
+		}
+		sort.Strings(zones)
+
+		segs := strings.Split(instanceName, ".")
+		if len(segs) != 2 {
+			log.Fatalf("parsing instance family %s, got %v", instanceName, segs)
+		}
+		family := segs[0]
+		if family != previousFamily {
+			previousFamily = family
+			newline(src)
+			fmt.Fprintf(src, "// %s family\n", family)
+		}
+
+		fmt.Fprintf(src, "\"%s\": {", instanceName)
+		for _, zone := range zones {
+			price, err := pricingProvider.SpotPrice(instanceName, zone)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(src, `"%s":%f, `, zone, price)
+		}
+		fmt.Fprintln(src, "},")
+	}
+	fmt.Fprintln(src, "\n}")
+	fmt.Fprintln(src)
+}
+
+// writeEBSPricing emits a map[string]float64 keyed by EBS volume type,
+// skipping types getPrice reports zero for (either genuinely unpriced, or not
+// applicable, as with the IOPS/throughput surcharge maps for volume types
+// that don't bill for them).
+func writeEBSPricing(src *bytes.Buffer, volumeTypes []string, varName string, getPrice func(volumeType string) (float64, error)) {
+	fmt.Fprintf(src, "var %s = map[string]float64{\n", varName)
+	sort.Strings(volumeTypes)
+	for _, volumeType := range volumeTypes {
+		price, err := getPrice(volumeType)
+		if err != nil || price == 0 {
+			continue
+		}
+		fmt.Fprintf(src, `"%s":%f, `, volumeType, price)
+	}
+	fmt.Fprintln(src, "\n}")
+	fmt.Fprintln(src)
+}
+
 // newline adds a newline to src, if it does not currently already end with a newline
 func newline(src *bytes.Buffer) {
 	contents := src.Bytes()
@@ -0,0 +1,53 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import "testing"
+
+func TestRegionIdentifier(t *testing.T) {
+	cases := map[string]string{
+		"us-east-1":      "UsEast1",
+		"eu-west-1":      "EuWest1",
+		"ap-southeast-2": "ApSoutheast2",
+		"us-gov-west-1":  "UsGovWest1",
+	}
+	for region, want := range cases {
+		if got := regionIdentifier(region); got != want {
+			t.Errorf("regionIdentifier(%q) = %q, want %q", region, got, want)
+		}
+	}
+}
+
+// TestVarNamesAreRegionScoped guards against the duplicate top-level
+// declaration bug fixed in 0a79b26: every per-region var-name helper must
+// produce a distinct identifier per region, or the generated per-region files
+// redeclare the same package-level var and fail to compile.
+func TestVarNamesAreRegionScoped(t *testing.T) {
+	helpers := map[string]func(string) string{
+		"onDemandVarName":      onDemandVarName,
+		"spotVarName":          spotVarName,
+		"ebsVarName":           ebsVarName,
+		"ebsIOPSVarName":       ebsIOPSVarName,
+		"ebsThroughputVarName": ebsThroughputVarName,
+		"priceUpdateVarName":   priceUpdateVarName,
+	}
+	for name, helper := range helpers {
+		usEast1 := helper("us-east-1")
+		euWest1 := helper("eu-west-1")
+		if usEast1 == euWest1 {
+			t.Errorf("%s produced the same identifier %q for us-east-1 and eu-west-1", name, usEast1)
+		}
+	}
+}
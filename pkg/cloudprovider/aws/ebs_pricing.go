@@ -0,0 +1,139 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// gp3BaselineIOPS and gp3BaselineThroughputMBps are the amounts of
+	// provisioned IOPS and throughput included in a gp3 volume's base price;
+	// only usage above these is billed as a surcharge.
+	gp3BaselineIOPS           = 3000
+	gp3BaselineThroughputMBps = 125
+)
+
+// EBSPricing is the per-GB-month price for an EBS volume type, plus the
+// surcharges some volume types bill for provisioned IOPS and throughput
+// above their baseline.
+type EBSPricing struct {
+	PricePerGBMonth float64
+	// PricePerIOPSMonth is the surcharge per provisioned IOPS/month, for
+	// volume types that charge for it (gp3 above the baseline, io1/io2 for
+	// all provisioned IOPS). Zero for volume types that don't.
+	PricePerIOPSMonth float64
+	// PricePerMBpsMonth is the surcharge per provisioned MB/s of
+	// throughput/month, for volume types that charge for it (gp3 above the
+	// baseline). Zero for volume types that don't.
+	PricePerMBpsMonth float64
+}
+
+// updateEBSPricing asks source for this provider's region and caches
+// whatever it returns.
+func (p *PricingProvider) updateEBSPricing(ctx context.Context, source PricingSource) {
+	prices, err := source.GetEBSPrices(ctx, p.region)
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ebsPrices = prices
+	p.ebsLastUpdated = time.Now()
+}
+
+// EBSLastUpdated returns the last time EBS pricing was refreshed.
+func (p *PricingProvider) EBSLastUpdated() time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.ebsLastUpdated
+}
+
+// EBSVolumeTypes returns the set of EBS volume types with known pricing.
+func (p *PricingProvider) EBSVolumeTypes() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	volumeTypes := make([]string, 0, len(p.ebsPrices))
+	for volumeType := range p.ebsPrices {
+		volumeTypes = append(volumeTypes, volumeType)
+	}
+	return volumeTypes
+}
+
+// EBSBasePrice returns the cached per-GB-month price for volumeType, with no
+// IOPS or throughput surcharges applied.
+func (p *PricingProvider) EBSBasePrice(volumeType string) (float64, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	pricing, ok := p.ebsPrices[volumeType]
+	if !ok {
+		return 0, fmt.Errorf("no EBS pricing data for volume type %s", volumeType)
+	}
+	return pricing.PricePerGBMonth, nil
+}
+
+// EBSIOPSPrice returns the cached per-provisioned-IOPS-month surcharge for
+// volumeType. Volume types that don't bill for IOPS return zero.
+func (p *PricingProvider) EBSIOPSPrice(volumeType string) (float64, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	pricing, ok := p.ebsPrices[volumeType]
+	if !ok {
+		return 0, fmt.Errorf("no EBS pricing data for volume type %s", volumeType)
+	}
+	return pricing.PricePerIOPSMonth, nil
+}
+
+// EBSThroughputPrice returns the cached per-provisioned-MB/s-month surcharge
+// for volumeType. Volume types that don't bill for throughput return zero.
+func (p *PricingProvider) EBSThroughputPrice(volumeType string) (float64, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	pricing, ok := p.ebsPrices[volumeType]
+	if !ok {
+		return 0, fmt.Errorf("no EBS pricing data for volume type %s", volumeType)
+	}
+	return pricing.PricePerMBpsMonth, nil
+}
+
+// EBSPrice estimates the monthly price of an EBS volume of volumeType, sized
+// sizeGiB, optionally provisioned with iops and throughput (in MB/s). iops
+// and throughput are only billed where the volume type charges for them: all
+// provisioned IOPS for io1/io2, and usage above the baseline for gp3.
+func (p *PricingProvider) EBSPrice(volumeType string, sizeGiB int64, iops int64, throughput int64) (float64, error) {
+	p.mu.RLock()
+	pricing, ok := p.ebsPrices[volumeType]
+	p.mu.RUnlock()
+	if !ok {
+		return 0, fmt.Errorf("no EBS pricing data for volume type %s", volumeType)
+	}
+
+	price := pricing.PricePerGBMonth * float64(sizeGiB)
+	switch volumeType {
+	case "gp3":
+		if extraIOPS := iops - gp3BaselineIOPS; extraIOPS > 0 {
+			price += float64(extraIOPS) * pricing.PricePerIOPSMonth
+		}
+		if extraThroughput := throughput - gp3BaselineThroughputMBps; extraThroughput > 0 {
+			price += float64(extraThroughput) * pricing.PricePerMBpsMonth
+		}
+	case "io1", "io2":
+		price += float64(iops) * pricing.PricePerIOPSMonth
+	}
+	return price, nil
+}
@@ -0,0 +1,165 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aws
+
+import "testing"
+
+func TestParseEBSBasePrice(t *testing.T) {
+	raw := mustJSONValue(t, `{
+		"product": {"attributes": {"volumeApiName": "gp3"}},
+		"terms": {"OnDemand": {"sku.term": {"priceDimensions": {"sku.term.dim": {"pricePerUnit": {"USD": "0.080000"}}}}}}
+	}`)
+
+	volumeType, price, err := parseEBSBasePrice(raw)
+	if err != nil {
+		t.Fatalf("parseEBSBasePrice returned error: %s", err)
+	}
+	if volumeType != "gp3" {
+		t.Errorf("volumeType = %q, want gp3", volumeType)
+	}
+	if price != 0.08 {
+		t.Errorf("price = %f, want 0.08", price)
+	}
+}
+
+func TestParseEBSBasePriceRejectsNonVolumeDocument(t *testing.T) {
+	raw := mustJSONValue(t, `{
+		"product": {"attributes": {}},
+		"terms": {"OnDemand": {}}
+	}`)
+
+	if _, _, err := parseEBSBasePrice(raw); err == nil {
+		t.Fatal("expected an error for a document with no volumeApiName")
+	}
+}
+
+func TestParseEBSSurcharge(t *testing.T) {
+	raw := mustJSONValue(t, `{
+		"product": {"attributes": {"volumeApiName": "io2", "group": "EBS IOPS"}},
+		"terms": {"OnDemand": {"sku.term": {"priceDimensions": {"sku.term.dim": {"pricePerUnit": {"USD": "0.065000"}}}}}}
+	}`)
+
+	volumeType, group, price, err := parseEBSSurcharge(raw)
+	if err != nil {
+		t.Fatalf("parseEBSSurcharge returned error: %s", err)
+	}
+	if volumeType != "io2" {
+		t.Errorf("volumeType = %q, want io2", volumeType)
+	}
+	if group != "EBS IOPS" {
+		t.Errorf("group = %q, want \"EBS IOPS\"", group)
+	}
+	if price != 0.065 {
+		t.Errorf("price = %f, want 0.065", price)
+	}
+}
+
+func bulkEBSOfferFixture() []byte {
+	return []byte(`{
+		"products": {
+			"gp3-storage": {
+				"productFamily": "Storage",
+				"attributes": {"volumeApiName": "gp3"}
+			},
+			"io2-storage": {
+				"productFamily": "Storage",
+				"attributes": {"volumeApiName": "io2"}
+			},
+			"compute-excluded": {
+				"productFamily": "Compute Instance",
+				"attributes": {"instanceType": "m5.large"}
+			}
+		},
+		"terms": {
+			"OnDemand": {
+				"gp3-storage": {"gp3-storage.term": {"priceDimensions": {"dim": {"pricePerUnit": {"USD": "0.080000"}}}}},
+				"io2-storage": {"io2-storage.term": {"priceDimensions": {"dim": {"pricePerUnit": {"USD": "0.125000"}}}}},
+				"compute-excluded": {"compute-excluded.term": {"priceDimensions": {"dim": {"pricePerUnit": {"USD": "0.096000"}}}}}
+			}
+		}
+	}`)
+}
+
+func TestParseBulkEBSPrices(t *testing.T) {
+	prices, err := parseBulkEBSPrices(bulkEBSOfferFixture())
+	if err != nil {
+		t.Fatalf("parseBulkEBSPrices returned error: %s", err)
+	}
+
+	if len(prices) != 2 {
+		t.Fatalf("prices = %v, want exactly gp3 and io2", prices)
+	}
+	if got := prices["gp3"].PricePerGBMonth; got != 0.08 {
+		t.Errorf("prices[gp3].PricePerGBMonth = %f, want 0.08", got)
+	}
+	if got := prices["io2"].PricePerGBMonth; got != 0.125 {
+		t.Errorf("prices[io2].PricePerGBMonth = %f, want 0.125", got)
+	}
+	if _, ok := prices["m5.large"]; ok {
+		t.Errorf("expected the Compute Instance product to be filtered out")
+	}
+}
+
+func newTestPricingProvider(ebsPrices map[string]EBSPricing) *PricingProvider {
+	return &PricingProvider{ebsPrices: ebsPrices}
+}
+
+func TestEBSPriceGP3BillsOnlyUsageAboveBaseline(t *testing.T) {
+	p := newTestPricingProvider(map[string]EBSPricing{
+		"gp3": {PricePerGBMonth: 0.08, PricePerIOPSMonth: 0.005, PricePerMBpsMonth: 0.04},
+	})
+
+	// At or below the baseline IOPS and throughput, only the base price applies.
+	price, err := p.EBSPrice("gp3", 100, gp3BaselineIOPS, gp3BaselineThroughputMBps)
+	if err != nil {
+		t.Fatalf("EBSPrice returned error: %s", err)
+	}
+	if want := 0.08 * 100; price != want {
+		t.Errorf("price = %f, want %f (base only)", price, want)
+	}
+
+	// Above the baseline, the surcharge applies only to the excess.
+	price, err = p.EBSPrice("gp3", 100, gp3BaselineIOPS+1000, gp3BaselineThroughputMBps+100)
+	if err != nil {
+		t.Fatalf("EBSPrice returned error: %s", err)
+	}
+	want := 0.08*100 + 1000*0.005 + 100*0.04
+	if price != want {
+		t.Errorf("price = %f, want %f (base + surcharges on excess only)", price, want)
+	}
+}
+
+func TestEBSPriceIO1BillsAllProvisionedIOPS(t *testing.T) {
+	p := newTestPricingProvider(map[string]EBSPricing{
+		"io1": {PricePerGBMonth: 0.125, PricePerIOPSMonth: 0.065},
+	})
+
+	price, err := p.EBSPrice("io1", 100, 500, 0)
+	if err != nil {
+		t.Fatalf("EBSPrice returned error: %s", err)
+	}
+	want := 0.125*100 + 500*0.065
+	if price != want {
+		t.Errorf("price = %f, want %f (io1 bills all provisioned IOPS, not just above a baseline)", price, want)
+	}
+}
+
+func TestEBSPriceUnknownVolumeType(t *testing.T) {
+	p := newTestPricingProvider(map[string]EBSPricing{})
+
+	if _, err := p.EBSPrice("gp3", 100, 0, 0); err == nil {
+		t.Fatal("expected an error for a volume type with no cached pricing")
+	}
+}
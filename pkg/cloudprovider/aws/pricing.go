@@ -0,0 +1,293 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aws
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/aws/aws-sdk-go/service/pricing"
+	"github.com/aws/aws-sdk-go/service/pricing/pricingiface"
+)
+
+const (
+	// defaultRefreshInterval is how often on-demand, spot, and EBS pricing
+	// are refreshed when NewPricingProvider is given a zero refreshInterval.
+	defaultRefreshInterval = 12 * time.Hour
+)
+
+// PricingProvider maintains an in-memory cache of on-demand, spot, and EBS
+// prices for the region it was constructed with, refreshing all three in the
+// background.
+type PricingProvider struct {
+	ec2    ec2iface.EC2API
+	region string
+
+	mu                  sync.RWMutex
+	onDemandPrices      map[string]float64
+	onDemandLastUpdated time.Time
+
+	// spotPrices is keyed by instanceType -> availabilityZone -> price.
+	spotPrices          map[string]map[string]float64
+	spotLastUpdated     time.Time
+	spotZoneLastUpdated map[string]time.Time
+
+	// ebsPrices is keyed by EBS volume type (gp2, gp3, io1, io2, st1, sc1,
+	// standard).
+	ebsPrices      map[string]EBSPricing
+	ebsLastUpdated time.Time
+}
+
+// NewPricingProvider creates a PricingProvider and starts its background
+// on-demand, EBS, and spot price refresh loops. done closes to stop all
+// three. refreshInterval controls how often each loop refreshes; a zero
+// value uses defaultRefreshInterval. isolatedVPC is reserved for sources that
+// need to special-case accounts without internet egress.
+func NewPricingProvider(ctx context.Context, source PricingSource, ec2api ec2iface.EC2API, region string, isolatedVPC bool, refreshInterval time.Duration, done <-chan struct{}) *PricingProvider {
+	if refreshInterval <= 0 {
+		refreshInterval = defaultRefreshInterval
+	}
+	p := &PricingProvider{
+		ec2:                 ec2api,
+		region:              region,
+		onDemandPrices:      map[string]float64{},
+		spotPrices:          map[string]map[string]float64{},
+		spotZoneLastUpdated: map[string]time.Time{},
+		ebsPrices:           map[string]EBSPricing{},
+	}
+
+	go func() {
+		p.updateOnDemandPricing(ctx, source)
+		p.updateEBSPricing(ctx, source)
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				p.updateOnDemandPricing(ctx, source)
+				p.updateEBSPricing(ctx, source)
+			}
+		}
+	}()
+	go func() {
+		p.updateSpotPricing(ctx)
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				p.updateSpotPricing(ctx)
+			}
+		}
+	}()
+	return p
+}
+
+// updateOnDemandPricing asks source for this provider's region and caches
+// whatever it returns.
+func (p *PricingProvider) updateOnDemandPricing(ctx context.Context, source PricingSource) {
+	prices, err := source.GetOnDemandPrices(ctx, p.region)
+	if err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onDemandPrices = prices
+	p.onDemandLastUpdated = time.Now()
+}
+
+// NewPricingAPI constructs the AWS Pricing API client used by the generator
+// and NewLivePricingSource. The Pricing API is only available in us-east-1
+// and ap-south-1, so callers always get us-east-1 here regardless of the
+// region being priced.
+func NewPricingAPI(sess *session.Session, region string) pricingiface.PricingAPI {
+	return pricing.New(sess, aws.NewConfig().WithRegion("us-east-1"))
+}
+
+// spotPriceObservation is a single (instanceType, AZ) price point from
+// DescribeSpotPriceHistory.
+type spotPriceObservation struct {
+	instanceType string
+	zone         string
+	price        float64
+	timestamp    time.Time
+}
+
+// updateSpotPricing calls DescribeSpotPriceHistory with StartTime set to now,
+// which returns only the most recent price per (instanceType, AZ) pair, and
+// keeps the newest entry it sees for each pair.
+func (p *PricingProvider) updateSpotPricing(ctx context.Context) {
+	now := time.Now()
+	var observations []spotPriceObservation
+
+	input := &ec2.DescribeSpotPriceHistoryInput{
+		ProductDescriptions: []*string{aws.String("Linux/UNIX")},
+		StartTime:           aws.Time(now),
+	}
+	if err := p.ec2.DescribeSpotPriceHistoryPagesWithContext(ctx, input, func(output *ec2.DescribeSpotPriceHistoryOutput, lastPage bool) bool {
+		for _, entry := range output.SpotPriceHistory {
+			if entry.InstanceType == nil || entry.AvailabilityZone == nil || entry.SpotPrice == nil || entry.Timestamp == nil {
+				continue
+			}
+			price, err := parsePrice(*entry.SpotPrice)
+			if err != nil {
+				continue
+			}
+			observations = append(observations, spotPriceObservation{
+				instanceType: *entry.InstanceType,
+				zone:         *entry.AvailabilityZone,
+				price:        price,
+				timestamp:    *entry.Timestamp,
+			})
+		}
+		return true
+	}); err != nil {
+		return
+	}
+
+	prices, zoneUpdated := dedupeSpotPriceObservations(observations)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.spotPrices = prices
+	for zone, ts := range zoneUpdated {
+		p.spotZoneLastUpdated[zone] = ts
+	}
+	p.spotLastUpdated = now
+}
+
+// dedupeSpotPriceObservations keeps, for each (instanceType, zone) pair, the
+// observation with the latest timestamp, and returns the resulting price map
+// alongside the latest observation timestamp seen per zone across all
+// instance types.
+func dedupeSpotPriceObservations(observations []spotPriceObservation) (map[string]map[string]float64, map[string]time.Time) {
+	type pairKey struct {
+		instanceType string
+		zone         string
+	}
+	latestByPair := map[pairKey]time.Time{}
+	prices := map[string]map[string]float64{}
+	zoneUpdated := map[string]time.Time{}
+
+	for _, obs := range observations {
+		key := pairKey{obs.instanceType, obs.zone}
+		if seen, ok := latestByPair[key]; ok && obs.timestamp.Before(seen) {
+			continue
+		}
+		latestByPair[key] = obs.timestamp
+
+		if _, ok := prices[obs.instanceType]; !ok {
+			prices[obs.instanceType] = map[string]float64{}
+		}
+		prices[obs.instanceType][obs.zone] = obs.price
+
+		if obs.timestamp.After(zoneUpdated[obs.zone]) {
+			zoneUpdated[obs.zone] = obs.timestamp
+		}
+	}
+	return prices, zoneUpdated
+}
+
+// SpotPrice returns the most recently observed spot price for instanceType
+// in zone.
+func (p *PricingProvider) SpotPrice(instanceType string, zone string) (float64, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	zonal, ok := p.spotPrices[instanceType]
+	if !ok {
+		return 0.0, fmt.Errorf("no spot pricing data for instance type %s", instanceType)
+	}
+	price, ok := zonal[zone]
+	if !ok {
+		return 0.0, fmt.Errorf("no spot pricing data for instance type %s in zone %s", instanceType, zone)
+	}
+	return price, nil
+}
+
+// SpotLastUpdated returns the last time the spot pricing cache as a whole was
+// refreshed.
+func (p *PricingProvider) SpotLastUpdated() time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.spotLastUpdated
+}
+
+// SpotZoneLastUpdated returns the last time spot pricing was observed for
+// zone specifically. If zone has never reported a price, it returns the zero
+// time.
+func (p *PricingProvider) SpotZoneLastUpdated(zone string) time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.spotZoneLastUpdated[zone]
+}
+
+// OnDemandPrice returns the last cached on-demand price for instanceType.
+func (p *PricingProvider) OnDemandPrice(instanceType string) (float64, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	price, ok := p.onDemandPrices[instanceType]
+	if !ok {
+		return 0.0, fmt.Errorf("no on-demand pricing data for instance type %s", instanceType)
+	}
+	return price, nil
+}
+
+// OnDemandLastUpdated returns the last time on-demand pricing was refreshed.
+func (p *PricingProvider) OnDemandLastUpdated() time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.onDemandLastUpdated
+}
+
+// InstanceTypes returns the set of instance types with known on-demand
+// pricing.
+func (p *PricingProvider) InstanceTypes() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	instanceTypes := make([]string, 0, len(p.onDemandPrices))
+	for instanceType := range p.onDemandPrices {
+		instanceTypes = append(instanceTypes, instanceType)
+	}
+	return instanceTypes
+}
+
+// SpotZones returns the set of availability zones with known spot pricing
+// for instanceType.
+func (p *PricingProvider) SpotZones(instanceType string) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	zones := make([]string, 0, len(p.spotPrices[instanceType]))
+	for zone := range p.spotPrices[instanceType] {
+		zones = append(zones, zone)
+	}
+	return zones
+}
+
+func parsePrice(s string) (float64, error) {
+	var price float64
+	_, err := fmt.Sscanf(s, "%f", &price)
+	return price, err
+}
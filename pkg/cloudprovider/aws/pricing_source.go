@@ -0,0 +1,409 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/pricing"
+	"github.com/aws/aws-sdk-go/service/pricing/pricingiface"
+)
+
+// PricingSource abstracts where a PricingProvider's on-demand and EBS prices
+// come from, so the generator can regenerate pricing from either a live AWS
+// account or a mirrored bulk price list without AWS credentials.
+type PricingSource interface {
+	// GetOnDemandPrices returns instanceType -> price for region.
+	GetOnDemandPrices(ctx context.Context, region string) (map[string]float64, error)
+	// GetEBSPrices returns EBS volume type -> price for region.
+	GetEBSPrices(ctx context.Context, region string) (map[string]EBSPricing, error)
+}
+
+// livePricingSource is the default PricingSource, backed by the AWS Pricing
+// API. This is the behavior PricingProvider had before PricingSource existed.
+type livePricingSource struct {
+	pricingAPI pricingiface.PricingAPI
+}
+
+// NewLivePricingSource returns a PricingSource backed by the AWS Pricing API.
+func NewLivePricingSource(pricingAPI pricingiface.PricingAPI) PricingSource {
+	return &livePricingSource{pricingAPI: pricingAPI}
+}
+
+func (s *livePricingSource) GetOnDemandPrices(ctx context.Context, region string) (map[string]float64, error) {
+	prices := map[string]float64{}
+	input := &pricing.GetProductsInput{
+		ServiceCode: aws.String("AmazonEC2"),
+		Filters:     onDemandFilters(region),
+	}
+	if err := s.pricingAPI.GetProductsPagesWithContext(ctx, input, func(output *pricing.GetProductsOutput, lastPage bool) bool {
+		for _, priceDoc := range output.PriceList {
+			instanceType, price, err := parseOnDemandPrice(priceDoc)
+			if err != nil {
+				continue
+			}
+			prices[instanceType] = price
+		}
+		return true
+	}); err != nil {
+		return nil, err
+	}
+	return prices, nil
+}
+
+func (s *livePricingSource) GetEBSPrices(ctx context.Context, region string) (map[string]EBSPricing, error) {
+	prices := map[string]EBSPricing{}
+	input := &pricing.GetProductsInput{
+		ServiceCode: aws.String("AmazonEC2"),
+		Filters: []*pricing.Filter{
+			{Type: aws.String("TERM_MATCH"), Field: aws.String("regionCode"), Value: aws.String(region)},
+			{Type: aws.String("TERM_MATCH"), Field: aws.String("productFamily"), Value: aws.String("Storage")},
+		},
+	}
+	if err := s.pricingAPI.GetProductsPagesWithContext(ctx, input, func(output *pricing.GetProductsOutput, lastPage bool) bool {
+		for _, priceDoc := range output.PriceList {
+			volumeType, price, err := parseEBSBasePrice(priceDoc)
+			if err != nil {
+				continue
+			}
+			entry := prices[volumeType]
+			entry.PricePerGBMonth = price
+			prices[volumeType] = entry
+		}
+		return true
+	}); err != nil {
+		return nil, err
+	}
+
+	// Provisioned IOPS and throughput are billed as separate "System
+	// Operation" line items rather than as part of the Storage product.
+	surchargeInput := &pricing.GetProductsInput{
+		ServiceCode: aws.String("AmazonEC2"),
+		Filters: []*pricing.Filter{
+			{Type: aws.String("TERM_MATCH"), Field: aws.String("regionCode"), Value: aws.String(region)},
+			{Type: aws.String("TERM_MATCH"), Field: aws.String("productFamily"), Value: aws.String("System Operation")},
+		},
+	}
+	if err := s.pricingAPI.GetProductsPagesWithContext(ctx, surchargeInput, func(output *pricing.GetProductsOutput, lastPage bool) bool {
+		for _, priceDoc := range output.PriceList {
+			volumeType, group, price, err := parseEBSSurcharge(priceDoc)
+			if err != nil {
+				continue
+			}
+			entry := prices[volumeType]
+			switch group {
+			case "EBS IOPS":
+				entry.PricePerIOPSMonth = price
+			case "EBS Throughput":
+				entry.PricePerMBpsMonth = price
+			default:
+				continue
+			}
+			prices[volumeType] = entry
+		}
+		return true
+	}); err != nil {
+		return nil, err
+	}
+	return prices, nil
+}
+
+// ebsPriceDocument is the subset of the AWS Pricing API's per-product JSON
+// response needed to parse both Storage and System Operation line items.
+type ebsPriceDocument struct {
+	Product struct {
+		Attributes struct {
+			VolumeAPIName string `json:"volumeApiName"`
+			Group         string `json:"group"`
+		} `json:"attributes"`
+	} `json:"product"`
+	Terms struct {
+		OnDemand map[string]struct {
+			PriceDimensions map[string]struct {
+				PricePerUnit struct {
+					USD string `json:"USD"`
+				} `json:"pricePerUnit"`
+			} `json:"priceDimensions"`
+		} `json:"OnDemand"`
+	} `json:"terms"`
+}
+
+func parseEBSBasePrice(raw aws.JSONValue) (string, float64, error) {
+	doc, err := decodeEBSPriceDocument(raw)
+	if err != nil {
+		return "", 0, err
+	}
+	if doc.Product.Attributes.VolumeAPIName == "" {
+		return "", 0, fmt.Errorf("not a volume price document")
+	}
+	price, err := firstEBSPrice(doc)
+	if err != nil {
+		return "", 0, err
+	}
+	return doc.Product.Attributes.VolumeAPIName, price, nil
+}
+
+func parseEBSSurcharge(raw aws.JSONValue) (volumeType string, group string, price float64, err error) {
+	doc, err := decodeEBSPriceDocument(raw)
+	if err != nil {
+		return "", "", 0, err
+	}
+	if doc.Product.Attributes.VolumeAPIName == "" {
+		return "", "", 0, fmt.Errorf("not a volume surcharge document")
+	}
+	price, err = firstEBSPrice(doc)
+	if err != nil {
+		return "", "", 0, err
+	}
+	return doc.Product.Attributes.VolumeAPIName, doc.Product.Attributes.Group, price, nil
+}
+
+func decodeEBSPriceDocument(raw aws.JSONValue) (ebsPriceDocument, error) {
+	doc := ebsPriceDocument{}
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return doc, err
+	}
+	if err := json.Unmarshal(encoded, &doc); err != nil {
+		return doc, err
+	}
+	return doc, nil
+}
+
+func firstEBSPrice(doc ebsPriceDocument) (float64, error) {
+	for _, term := range doc.Terms.OnDemand {
+		for _, dimension := range term.PriceDimensions {
+			price, err := parsePrice(dimension.PricePerUnit.USD)
+			if err != nil {
+				continue
+			}
+			return price, nil
+		}
+	}
+	return 0, fmt.Errorf("no price dimension found")
+}
+
+// onDemandPriceDocument is the subset of the AWS Pricing API's per-product
+// JSON response this provider cares about.
+type onDemandPriceDocument struct {
+	Product struct {
+		Attributes struct {
+			InstanceType string `json:"instanceType"`
+		} `json:"attributes"`
+	} `json:"product"`
+	Terms struct {
+		OnDemand map[string]struct {
+			PriceDimensions map[string]struct {
+				PricePerUnit struct {
+					USD string `json:"USD"`
+				} `json:"pricePerUnit"`
+			} `json:"priceDimensions"`
+		} `json:"OnDemand"`
+	} `json:"terms"`
+}
+
+func parseOnDemandPrice(raw aws.JSONValue) (string, float64, error) {
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return "", 0, err
+	}
+	doc := onDemandPriceDocument{}
+	if err := json.Unmarshal(encoded, &doc); err != nil {
+		return "", 0, err
+	}
+	for _, term := range doc.Terms.OnDemand {
+		for _, dimension := range term.PriceDimensions {
+			price, err := parsePrice(dimension.PricePerUnit.USD)
+			if err != nil {
+				continue
+			}
+			return doc.Product.Attributes.InstanceType, price, nil
+		}
+	}
+	return "", 0, fmt.Errorf("no on-demand price dimension found")
+}
+
+func onDemandFilters(region string) []*pricing.Filter {
+	return []*pricing.Filter{
+		{Type: aws.String("TERM_MATCH"), Field: aws.String("regionCode"), Value: aws.String(region)},
+		{Type: aws.String("TERM_MATCH"), Field: aws.String("capacitystatus"), Value: aws.String("Used")},
+		{Type: aws.String("TERM_MATCH"), Field: aws.String("preInstalledSw"), Value: aws.String("NA")},
+		{Type: aws.String("TERM_MATCH"), Field: aws.String("tenancy"), Value: aws.String("Shared")},
+		{Type: aws.String("TERM_MATCH"), Field: aws.String("operatingSystem"), Value: aws.String("Linux")},
+	}
+}
+
+// defaultBulkURLTemplate is the public AWS Price List Bulk API endpoint for
+// EC2. %s is replaced with the region code being priced.
+const defaultBulkURLTemplate = "https://pricing.us-east-1.amazonaws.com/offers/v1.0/aws/AmazonEC2/current/%s/index.json"
+
+// bulkPricingSource reads the AWS Price List Bulk JSON format from wherever
+// load returns it, and applies the same filters the live Pricing API filters
+// by, since the bulk file is unfiltered.
+type bulkPricingSource struct {
+	load func(ctx context.Context, region string) ([]byte, error)
+}
+
+// NewFilePricingSource reads a local AWS Price List Bulk JSON file. path may
+// contain a "%s" placeholder, which is replaced with the region being priced,
+// so a single flag value can address one bulk file per region.
+func NewFilePricingSource(path string) PricingSource {
+	return &bulkPricingSource{
+		load: func(ctx context.Context, region string) ([]byte, error) {
+			return ioutil.ReadFile(regionalize(path, region))
+		},
+	}
+}
+
+// NewBulkURLPricingSource fetches the AWS Price List Bulk JSON over HTTP. An
+// empty urlTemplate falls back to the public AWS endpoint. urlTemplate may
+// contain a "%s" placeholder for the region being priced.
+func NewBulkURLPricingSource(urlTemplate string) PricingSource {
+	if urlTemplate == "" {
+		urlTemplate = defaultBulkURLTemplate
+	}
+	return &bulkPricingSource{
+		load: func(ctx context.Context, region string) ([]byte, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, regionalize(urlTemplate, region), nil)
+			if err != nil {
+				return nil, err
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("fetching bulk pricing, got status %s", resp.Status)
+			}
+			return ioutil.ReadAll(resp.Body)
+		},
+	}
+}
+
+func regionalize(template string, region string) string {
+	if strings.Contains(template, "%s") {
+		return fmt.Sprintf(template, region)
+	}
+	return template
+}
+
+func (s *bulkPricingSource) GetOnDemandPrices(ctx context.Context, region string) (map[string]float64, error) {
+	data, err := s.load(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	return parseBulkOnDemandPrices(data)
+}
+
+// GetEBSPrices parses the base per-GB-month Storage price for each volume
+// type out of the bulk file. The bulk file's System Operation line items
+// that carry the gp3/io1/io2 IOPS and throughput surcharges are not parsed
+// here, so those surcharges are always zero for this source.
+func (s *bulkPricingSource) GetEBSPrices(ctx context.Context, region string) (map[string]EBSPricing, error) {
+	data, err := s.load(ctx, region)
+	if err != nil {
+		return nil, err
+	}
+	return parseBulkEBSPrices(data)
+}
+
+// bulkOffer is the subset of the AWS Price List Bulk JSON format this
+// provider cares about.
+type bulkOffer struct {
+	Products map[string]struct {
+		ProductFamily string `json:"productFamily"`
+		Attributes    struct {
+			InstanceType    string `json:"instanceType"`
+			CapacityStatus  string `json:"capacitystatus"`
+			PreInstalledSw  string `json:"preInstalledSw"`
+			Tenancy         string `json:"tenancy"`
+			OperatingSystem string `json:"operatingSystem"`
+			VolumeAPIName   string `json:"volumeApiName"`
+		} `json:"attributes"`
+	} `json:"products"`
+	Terms struct {
+		OnDemand map[string]map[string]struct {
+			PriceDimensions map[string]struct {
+				PricePerUnit struct {
+					USD string `json:"USD"`
+				} `json:"pricePerUnit"`
+			} `json:"priceDimensions"`
+		} `json:"OnDemand"`
+	} `json:"terms"`
+}
+
+// parseBulkOnDemandPrices filters the bulk price list with the same
+// capacitystatus=Used, preInstalledSw=NA, tenancy=Shared, operatingSystem=Linux
+// criteria the live Pricing API is queried with, keeping the result small.
+func parseBulkOnDemandPrices(data []byte) (map[string]float64, error) {
+	offer := bulkOffer{}
+	if err := json.Unmarshal(data, &offer); err != nil {
+		return nil, err
+	}
+
+	prices := map[string]float64{}
+	for sku, product := range offer.Products {
+		if product.ProductFamily != "Compute Instance" {
+			continue
+		}
+		attrs := product.Attributes
+		if attrs.CapacityStatus != "Used" || attrs.PreInstalledSw != "NA" || attrs.Tenancy != "Shared" || attrs.OperatingSystem != "Linux" {
+			continue
+		}
+		for _, term := range offer.Terms.OnDemand[sku] {
+			for _, dimension := range term.PriceDimensions {
+				price, err := parsePrice(dimension.PricePerUnit.USD)
+				if err != nil {
+					continue
+				}
+				prices[attrs.InstanceType] = price
+			}
+		}
+	}
+	return prices, nil
+}
+
+// parseBulkEBSPrices extracts the base per-GB-month Storage price for each
+// volume type from the bulk price list.
+func parseBulkEBSPrices(data []byte) (map[string]EBSPricing, error) {
+	offer := bulkOffer{}
+	if err := json.Unmarshal(data, &offer); err != nil {
+		return nil, err
+	}
+
+	prices := map[string]EBSPricing{}
+	for sku, product := range offer.Products {
+		if product.ProductFamily != "Storage" || product.Attributes.VolumeAPIName == "" {
+			continue
+		}
+		for _, term := range offer.Terms.OnDemand[sku] {
+			for _, dimension := range term.PriceDimensions {
+				price, err := parsePrice(dimension.PricePerUnit.USD)
+				if err != nil {
+					continue
+				}
+				prices[product.Attributes.VolumeAPIName] = EBSPricing{PricePerGBMonth: price}
+			}
+		}
+	}
+	return prices, nil
+}
@@ -0,0 +1,132 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aws
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func mustJSONValue(t *testing.T, raw string) aws.JSONValue {
+	t.Helper()
+	v := aws.JSONValue{}
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		t.Fatalf("unmarshaling test fixture: %s", err)
+	}
+	return v
+}
+
+func TestParseOnDemandPrice(t *testing.T) {
+	raw := mustJSONValue(t, `{
+		"product": {"attributes": {"instanceType": "m5.large"}},
+		"terms": {"OnDemand": {"sku.term": {"priceDimensions": {"sku.term.dim": {"pricePerUnit": {"USD": "0.096000"}}}}}}
+	}`)
+
+	instanceType, price, err := parseOnDemandPrice(raw)
+	if err != nil {
+		t.Fatalf("parseOnDemandPrice returned error: %s", err)
+	}
+	if instanceType != "m5.large" {
+		t.Errorf("instanceType = %q, want m5.large", instanceType)
+	}
+	if price != 0.096 {
+		t.Errorf("price = %f, want 0.096", price)
+	}
+}
+
+func TestParseOnDemandPriceNoDimensions(t *testing.T) {
+	raw := mustJSONValue(t, `{
+		"product": {"attributes": {"instanceType": "m5.large"}},
+		"terms": {"OnDemand": {}}
+	}`)
+
+	if _, _, err := parseOnDemandPrice(raw); err == nil {
+		t.Fatal("expected an error when no price dimensions are present")
+	}
+}
+
+func bulkOfferFixture() []byte {
+	return []byte(`{
+		"products": {
+			"linux-used-shared": {
+				"productFamily": "Compute Instance",
+				"attributes": {
+					"instanceType": "m5.large",
+					"capacitystatus": "Used",
+					"preInstalledSw": "NA",
+					"tenancy": "Shared",
+					"operatingSystem": "Linux"
+				}
+			},
+			"windows-excluded": {
+				"productFamily": "Compute Instance",
+				"attributes": {
+					"instanceType": "m5.large",
+					"capacitystatus": "Used",
+					"preInstalledSw": "NA",
+					"tenancy": "Shared",
+					"operatingSystem": "Windows"
+				}
+			},
+			"dedicated-excluded": {
+				"productFamily": "Compute Instance",
+				"attributes": {
+					"instanceType": "c5.large",
+					"capacitystatus": "Used",
+					"preInstalledSw": "NA",
+					"tenancy": "Dedicated",
+					"operatingSystem": "Linux"
+				}
+			},
+			"storage-excluded": {
+				"productFamily": "Storage",
+				"attributes": {
+					"instanceType": "",
+					"capacitystatus": "Used",
+					"preInstalledSw": "NA",
+					"tenancy": "Shared",
+					"operatingSystem": "Linux"
+				}
+			}
+		},
+		"terms": {
+			"OnDemand": {
+				"linux-used-shared": {"linux-used-shared.term": {"priceDimensions": {"dim": {"pricePerUnit": {"USD": "0.096000"}}}}},
+				"windows-excluded": {"windows-excluded.term": {"priceDimensions": {"dim": {"pricePerUnit": {"USD": "0.192000"}}}}},
+				"dedicated-excluded": {"dedicated-excluded.term": {"priceDimensions": {"dim": {"pricePerUnit": {"USD": "0.170000"}}}}},
+				"storage-excluded": {"storage-excluded.term": {"priceDimensions": {"dim": {"pricePerUnit": {"USD": "0.100000"}}}}}
+			}
+		}
+	}`)
+}
+
+func TestParseBulkOnDemandPricesAppliesFilters(t *testing.T) {
+	prices, err := parseBulkOnDemandPrices(bulkOfferFixture())
+	if err != nil {
+		t.Fatalf("parseBulkOnDemandPrices returned error: %s", err)
+	}
+
+	if len(prices) != 1 {
+		t.Fatalf("prices = %v, want exactly the linux/used/shared entry", prices)
+	}
+	if price, ok := prices["m5.large"]; !ok || price != 0.096 {
+		t.Errorf("prices[m5.large] = %v, want 0.096", price)
+	}
+	if _, ok := prices["c5.large"]; ok {
+		t.Errorf("expected dedicated-tenancy c5.large to be filtered out")
+	}
+}
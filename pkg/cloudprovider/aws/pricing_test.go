@@ -0,0 +1,69 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aws
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDedupeSpotPriceObservationsKeepsNewestPerInstanceTypeAndZone(t *testing.T) {
+	older := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+
+	observations := []spotPriceObservation{
+		// c5.large arrives first with the newer timestamp in this zone...
+		{instanceType: "c5.large", zone: "us-east-1a", price: 0.08, timestamp: newer},
+		// ...and m5.large arrives after it with an older timestamp in the same
+		// zone. A zone-only dedup key would use c5.large's newer timestamp as a
+		// floor and incorrectly drop m5.large's only observation.
+		{instanceType: "m5.large", zone: "us-east-1a", price: 0.05, timestamp: older},
+	}
+
+	prices, zoneUpdated := dedupeSpotPriceObservations(observations)
+
+	m5Price, ok := prices["m5.large"]["us-east-1a"]
+	if !ok {
+		t.Fatalf("expected m5.large/us-east-1a to have a price, got none: %v", prices)
+	}
+	if m5Price != 0.05 {
+		t.Errorf("m5.large/us-east-1a price = %f, want 0.05", m5Price)
+	}
+
+	c5Price, ok := prices["c5.large"]["us-east-1a"]
+	if !ok || c5Price != 0.08 {
+		t.Errorf("c5.large/us-east-1a price = %v, want 0.08", c5Price)
+	}
+
+	if got := zoneUpdated["us-east-1a"]; !got.Equal(newer) {
+		t.Errorf("zoneUpdated[us-east-1a] = %v, want %v", got, newer)
+	}
+}
+
+func TestDedupeSpotPriceObservationsKeepsNewestOfRepeatedPair(t *testing.T) {
+	older := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+
+	observations := []spotPriceObservation{
+		{instanceType: "m5.large", zone: "us-east-1a", price: 0.05, timestamp: older},
+		{instanceType: "m5.large", zone: "us-east-1a", price: 0.07, timestamp: newer},
+	}
+
+	prices, _ := dedupeSpotPriceObservations(observations)
+
+	if price := prices["m5.large"]["us-east-1a"]; price != 0.07 {
+		t.Errorf("price = %f, want 0.07 (the newer observation)", price)
+	}
+}